@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// checkpointInterval is how many bytes of output accumulate between
+// automatic checkpoint writes.
+const checkpointInterval = 1 << 20 // 1 MiB
+
+// errInterrupted is returned by Process when a SIGINT arrived mid-transfer;
+// when --checkpoint is set, a checkpoint has already been written, so
+// --resume picks up from there. Without --checkpoint nothing is saved.
+var errInterrupted = errors.New("interrupted, checkpoint saved")
+
+// Checkpoint is the on-disk state written to --checkpoint, letting --resume
+// continue a transfer (and its rolling hash) without re-reading what was
+// already processed.
+type Checkpoint struct {
+	TotalRead   uint64 `json:"totalRead"`
+	OutputBytes uint64 `json:"outputBytes"`
+	SHA256      string `json:"sha256-so-far"`
+	// HashState is the marshaled sha256 digest state (base64), so --resume
+	// continues the same running hash instead of just recording its value.
+	HashState string `json:"hashState"`
+}
+
+// saveCheckpoint atomically writes cp to path, fsyncing before rename so a
+// crash never leaves a partially-written checkpoint.
+func saveCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("can't marshal checkpoint: %w", err)
+	}
+
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("can't create checkpoint file: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("can't write checkpoint file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("can't fsync checkpoint file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("can't close checkpoint file: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// loadCheckpoint reads a checkpoint previously written by saveCheckpoint.
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	var cp Checkpoint
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read checkpoint file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("can't parse checkpoint file: %w", err)
+	}
+
+	return &cp, nil
+}
+
+// trackingWriter wraps dst, maintaining a running sha256 of everything
+// written (so --checkpoint/--resume agree on a digest) and a byte counter
+// (for checkpoint intervals).
+type trackingWriter struct {
+	dst   io.Writer
+	hash  hash.Hash
+	bytes uint64
+}
+
+// newTrackingWriter builds a trackingWriter around dst, rehydrating its
+// hash and byte count from resumeState when resuming so the final digest
+// matches a non-resumed run over the same logical output.
+func newTrackingWriter(dst io.Writer, checkpointPath string, resumeState *Checkpoint) (*trackingWriter, error) {
+	h := sha256.New()
+	bytes := uint64(0)
+
+	if checkpointPath != "" && resumeState != nil && resumeState.HashState != "" {
+		state, err := base64.StdEncoding.DecodeString(resumeState.HashState)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode checkpoint hash state: %w", err)
+		}
+
+		unmarshaler, ok := h.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return nil, fmt.Errorf("sha256 implementation doesn't support resuming state")
+		}
+		if err := unmarshaler.UnmarshalBinary(state); err != nil {
+			return nil, fmt.Errorf("can't restore checkpoint hash state: %w", err)
+		}
+
+		bytes = resumeState.OutputBytes
+	}
+
+	return &trackingWriter{dst: dst, hash: h, bytes: bytes}, nil
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	if n > 0 {
+		w.hash.Write(p[:n])
+		w.bytes += uint64(n)
+	}
+
+	return n, err
+}
+
+// snapshot returns the Checkpoint representing w's current state.
+func (w *trackingWriter) snapshot(totalRead uint64) (Checkpoint, error) {
+	marshaler, ok := w.hash.(encoding.BinaryMarshaler)
+	if !ok {
+		return Checkpoint{}, fmt.Errorf("sha256 implementation doesn't support checkpointing state")
+	}
+
+	state, err := marshaler.MarshalBinary()
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("can't marshal hash state: %w", err)
+	}
+
+	return Checkpoint{
+		TotalRead:   totalRead,
+		OutputBytes: w.bytes,
+		SHA256:      hex.EncodeToString(w.hash.Sum(nil)),
+		HashState:   base64.StdEncoding.EncodeToString(state),
+	}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResumeMatchesNonResumedDigest runs a transfer straight through, then
+// runs it again split into an interrupted first third and a --resume'd
+// remainder, and checks the resumed run's final output (and checkpoint
+// SHA256) match the non-resumed one byte for byte.
+func TestResumeMatchesNonResumedDigest(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 5000)
+
+	opts := &Options{BlockSize: 777}
+	fp := &FileProcessor{}
+
+	var full bytes.Buffer
+	if err := fp.Process(context.Background(), bytes.NewReader(data), &full, opts); err != nil {
+		t.Fatalf("non-resumed Process: %v", err)
+	}
+	if !bytes.Equal(full.Bytes(), data) {
+		t.Fatalf("non-resumed output doesn't match input")
+	}
+	wantDigest := sha256.Sum256(full.Bytes())
+
+	dir := t.TempDir()
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+	outPath := filepath.Join(dir, "out.bin")
+
+	// first "interrupted" run: only the first third of the source ever
+	// gets processed before the checkpoint is taken.
+	cut := len(data) / 3
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatalf("create output: %v", err)
+	}
+	firstOpts := &Options{BlockSize: opts.BlockSize, CheckpointPath: checkpointPath}
+	if err := fp.Process(context.Background(), bytes.NewReader(data[:cut]), out, firstOpts); err != nil {
+		t.Fatalf("first-half Process: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("close first-half output: %v", err)
+	}
+
+	// resume: the source is the full input again (skipBytes fast-forwards
+	// it using the checkpoint), and the destination is reopened to append.
+	out, err = os.OpenFile(outPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("reopen output for resume: %v", err)
+	}
+	resumeOpts := &Options{BlockSize: opts.BlockSize, CheckpointPath: checkpointPath, Resume: true}
+	if err := fp.Process(context.Background(), bytes.NewReader(data), out, resumeOpts); err != nil {
+		t.Fatalf("resumed Process: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("close resumed output: %v", err)
+	}
+
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("read resumed output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("resumed output doesn't match input (len %d want %d)", len(got), len(data))
+	}
+
+	gotDigest := sha256.Sum256(got)
+	if gotDigest != wantDigest {
+		t.Fatalf("resumed digest %x doesn't match non-resumed digest %x", gotDigest, wantDigest)
+	}
+
+	cp, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatalf("loadCheckpoint: %v", err)
+	}
+	if cp.SHA256 != fmt.Sprintf("%x", wantDigest) {
+		t.Fatalf("final checkpoint sha256 %s doesn't match non-resumed digest %x", cp.SHA256, wantDigest)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// streamingConvs lists the --conv values that attach a compressor or
+// decompressor to the read/write chain, instead of transforming a block
+// in memory like upper_case/lower_case/trim_spaces do.
+var streamingConvs = map[string]bool{
+	"gzip":            true,
+	"gunzip":          true,
+	"deflate":         true,
+	"inflate":         true,
+	"zstd":            true,
+	"zstd_decompress": true,
+}
+
+// mutuallyExclusiveConvs lists conv pairs that can't both be requested,
+// since each pair compresses/decompresses the same format in opposite
+// directions.
+var mutuallyExclusiveConvs = [][2]string{
+	{"gzip", "gunzip"},
+	{"deflate", "inflate"},
+	{"zstd", "zstd_decompress"},
+}
+
+// compressConvs is the subset of streamingConvs that write (compress)
+// side output. processParallel runs these independently per block when
+// --parallel > 1, instead of processData wrapping dst with them as one
+// shared chain; see compressBlock.
+var compressConvs = map[string]bool{
+	"gzip":    true,
+	"deflate": true,
+	"zstd":    true,
+}
+
+// splitCompressConvs splits convs into the compress-side streaming convs
+// (gzip, deflate, zstd) and everything else, preserving each group's
+// relative order.
+func splitCompressConvs(convs []string) (compress, rest []string) {
+	for _, conv := range convs {
+		if compressConvs[conv] {
+			compress = append(compress, conv)
+		} else {
+			rest = append(rest, conv)
+		}
+	}
+
+	return compress, rest
+}
+
+// compressBlock runs data through a fresh instance of the writer chain for
+// convs/level entirely in memory, returning one self-contained compressed
+// frame. processParallel calls this so each worker compresses its own
+// block independently rather than funneling every block through a single
+// shared writer goroutine. The decompress side reads the resulting
+// sequence of frames back as one logical stream: gzip's reader is
+// multistream by default, klauspost/zstd's reads concatenated frames
+// natively, and multistreamFlateReader below gives raw deflate the same
+// behavior.
+func compressBlock(data []byte, convs []string, level int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writer, closeChain, err := buildWriterChain(&buf, convs, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("can't compress block: %w", err)
+	}
+
+	if err := closeChain(); err != nil {
+		return nil, fmt.Errorf("can't finalize compressed block: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildReaderChain wraps src with a decompressor for every streaming conv
+// in opts.Conv that reads from the source side (gunzip, inflate,
+// zstd_decompress), in the order given. The returned close func releases
+// any resources held by the chain (e.g. the zstd decoder).
+func buildReaderChain(src io.Reader, convs []string) (io.Reader, func() error, error) {
+	reader := src
+	var closers []func() error
+
+	for _, conv := range convs {
+		switch conv {
+		case "gunzip":
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't open gzip stream: %w", err)
+			}
+			reader = gz
+			closers = append(closers, gz.Close)
+		case "inflate":
+			fr := newMultistreamFlateReader(reader)
+			reader = fr
+			closers = append(closers, fr.Close)
+		case "zstd_decompress":
+			zr, err := zstd.NewReader(reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't open zstd stream: %w", err)
+			}
+			reader = zr
+			closers = append(closers, func() error { zr.Close(); return nil })
+		}
+	}
+
+	return reader, closeChain(closers), nil
+}
+
+// buildWriterChain wraps dst with a compressor for every streaming conv in
+// opts.Conv that writes to the destination side (gzip, deflate, zstd), in
+// the order given. level is forwarded as the compression level where the
+// algorithm supports one. The returned close func must be called after the
+// last Write to flush and write out any trailing footer/checksum.
+func buildWriterChain(dst io.Writer, convs []string, level int) (io.Writer, func() error, error) {
+	writer := dst
+	var closers []func() error
+
+	for _, conv := range convs {
+		switch conv {
+		case "gzip":
+			gw, err := gzip.NewWriterLevel(writer, gzipLevel(level))
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't open gzip writer: %w", err)
+			}
+			writer = gw
+			closers = append(closers, gw.Close)
+		case "deflate":
+			fw, err := flate.NewWriter(writer, flateLevel(level))
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't open deflate writer: %w", err)
+			}
+			writer = fw
+			closers = append(closers, fw.Close)
+		case "zstd":
+			zw, err := zstd.NewWriter(writer, zstd.WithEncoderLevel(zstdLevel(level)))
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't open zstd writer: %w", err)
+			}
+			writer = zw
+			closers = append(closers, zw.Close)
+		}
+	}
+
+	return writer, closeChain(reverse(closers)), nil
+}
+
+// closeChain returns a func that closes every closer, in the order given,
+// returning the first error encountered (but still attempting the rest).
+func closeChain(closers []func() error) func() error {
+	return func() error {
+		var firstErr error
+		for _, closeFn := range closers {
+			if err := closeFn(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+}
+
+// reverse returns closers in reverse order, so the outermost writer in a
+// chain (the one wrapping everything else) is closed first and flushes
+// into the writers it wraps, rather than the other way around.
+func reverse(closers []func() error) []func() error {
+	out := make([]func() error, len(closers))
+	for i, c := range closers {
+		out[len(closers)-1-i] = c
+	}
+	return out
+}
+
+// multistreamFlateReader decodes zero or more concatenated raw-deflate
+// streams from src as one continuous logical stream. Unlike gzip (which
+// defaults to multistream) or zstd (whose decoder reads concatenated
+// frames natively), a plain flate.Reader stops at the end of the first
+// stream and silently ignores anything after it — a problem once
+// --parallel compresses each block as its own independent deflate stream
+// (see compressBlock) rather than one continuous one.
+//
+// src is wrapped in a single shared bufio.Reader up front (rather than
+// handing flate.NewReader the raw src on every new stream) because
+// flate.NewReader otherwise wraps a non-io.ByteReader source in its own
+// internal buffer per call and over-reads past the end of the current
+// stream into the next one; a shared io.ByteReader makes it read exactly
+// as many bytes as the current stream needs, leaving the rest for the
+// following flate.NewReader call to pick up.
+type multistreamFlateReader struct {
+	br  *bufio.Reader
+	cur io.ReadCloser
+}
+
+func newMultistreamFlateReader(src io.Reader) *multistreamFlateReader {
+	return &multistreamFlateReader{br: bufio.NewReader(src)}
+}
+
+func (r *multistreamFlateReader) Read(p []byte) (int, error) {
+	for {
+		fresh := false
+		if r.cur == nil {
+			r.cur = flate.NewReader(r.br)
+			fresh = true
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF || (err == io.ErrUnexpectedEOF && fresh) {
+			r.cur.Close()
+			r.cur = nil
+
+			if n > 0 {
+				return n, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				// a fresh reader couldn't even read a header: src is
+				// genuinely exhausted, not just this stream.
+				return 0, io.EOF
+			}
+			// this stream ended cleanly; loop around to see whether
+			// another concatenated stream follows.
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (r *multistreamFlateReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+
+	return r.cur.Close()
+}
+
+// gzipLevel maps a --conv-level value to a gzip compression level,
+// defaulting to gzip.DefaultCompression when level is 0.
+func gzipLevel(level int) int {
+	if level == 0 {
+		return gzip.DefaultCompression
+	}
+	return level
+}
+
+// flateLevel maps a --conv-level value to a flate compression level,
+// defaulting to flate.DefaultCompression when level is 0.
+func flateLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// zstdLevel maps a --conv-level value to a zstd.EncoderLevel, defaulting
+// to the library's default level when level is 0.
+func zstdLevel(level int) zstd.EncoderLevel {
+	if level == 0 {
+		return zstd.SpeedDefault
+	}
+	return zstd.EncoderLevelFromZstd(level)
+}
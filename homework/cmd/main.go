@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"slices"
 	"strconv"
 	"strings"
+
+	"lesson3/storage"
 )
 
 const (
@@ -20,11 +25,16 @@ type Options struct {
 	From, To                 string
 	Offset, Limit, BlockSize uint64
 	Conv                     []string
+	ConvLevel                int
+	Progress                 bool
+	CheckpointPath           string
+	Resume                   bool
+	Parallel                 int
 }
 
 // DataProcessor interface for processing data
 type DataProcessor interface {
-	Process(src io.Reader, dst io.Writer, opts *Options) error
+	Process(ctx context.Context, src io.Reader, dst io.Writer, opts *Options) error
 	Convers(data []byte, conv string) []byte
 }
 
@@ -39,33 +49,101 @@ type ProcessingContext struct {
 	buffer    []byte
 	totalRead uint64
 	processor *FileProcessor
+	// pureConv holds the Conv entries applied per block in memory
+	// (upper_case, lower_case, trim_spaces); streaming conv modes
+	// (gzip, inflate, ...) are attached to src/dst as a chain instead,
+	// see buildReaderChain/buildWriterChain.
+	pureConv []string
+	// streamConv holds the compress-side streaming convs (gzip, deflate,
+	// zstd), non-empty only when processParallel is about to run them
+	// independently per block instead of processData wrapping dst with a
+	// single shared chain; see compressBlock.
+	streamConv []string
 	// fields for processing case with block-size=1
 	trimBuffer    []byte // summarized buffer for trim spaces
 	hasTrimSpaces bool
+	// tracking/checkpoint support: tracking always wraps dst, but
+	// checkpoints are only written when --checkpoint is set
+	tracking         *trackingWriter
+	nextCheckpointAt uint64
 }
 
-func newProcessingContext(src io.Reader, dst io.Writer, opts *Options, processor *FileProcessor) *ProcessingContext {
+// newProcessingContext builds a ProcessingContext for processing src into
+// dst. streamConv, when non-empty, is the compress-side streaming convs
+// (gzip, deflate, zstd) that processParallel should run independently per
+// block instead of processData having wrapped dst with them up front; pass
+// nil when dst already is (or doesn't need) that chain.
+func newProcessingContext(src io.Reader, dst io.Writer, opts *Options, processor *FileProcessor, resumeState *Checkpoint, streamConv []string) (*ProcessingContext, error) {
 	blockSize := opts.BlockSize
 	// set default size
 	if blockSize == 0 {
 		blockSize = defaultBlockSize
 	}
 
+	pureConv := make([]string, 0, len(opts.Conv))
+	for _, conv := range opts.Conv {
+		if !streamingConvs[conv] {
+			pureConv = append(pureConv, conv)
+		}
+	}
+
+	totalRead := uint64(0)
+	if resumeState != nil {
+		totalRead = resumeState.TotalRead
+	}
+
+	tracking, err := newTrackingWriter(dst, opts.CheckpointPath, resumeState)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ProcessingContext{
-		src:           src,
-		dst:           dst,
-		opts:          opts,
-		buffer:        make([]byte, blockSize),
-		totalRead:     0,
-		processor:     processor,
-		trimBuffer:    make([]byte, 0),
-		hasTrimSpaces: slices.Contains(opts.Conv, "trim_spaces"),
+		src:              src,
+		dst:              tracking,
+		opts:             opts,
+		buffer:           make([]byte, blockSize),
+		totalRead:        totalRead,
+		processor:        processor,
+		pureConv:         pureConv,
+		streamConv:       streamConv,
+		trimBuffer:       make([]byte, 0),
+		hasTrimSpaces:    slices.Contains(opts.Conv, "trim_spaces"),
+		tracking:         tracking,
+		nextCheckpointAt: tracking.bytes + checkpointInterval,
+	}, nil
+}
+
+// maybeCheckpoint writes a checkpoint once ctx.tracking has produced
+// another checkpointInterval worth of output.
+func (ctx *ProcessingContext) maybeCheckpoint() error {
+	if ctx.opts.CheckpointPath == "" || ctx.tracking.bytes < ctx.nextCheckpointAt {
+		return nil
+	}
+
+	ctx.nextCheckpointAt = ctx.tracking.bytes + checkpointInterval
+
+	return ctx.checkpoint()
+}
+
+// checkpoint saves the current totalRead/outputBytes/rolling-hash state to
+// opts.CheckpointPath.
+func (ctx *ProcessingContext) checkpoint() error {
+	if ctx.opts.CheckpointPath == "" {
+		return nil
 	}
+
+	cp, err := ctx.tracking.snapshot(ctx.totalRead)
+	if err != nil {
+		return fmt.Errorf("can't snapshot checkpoint state: %w", err)
+	}
+
+	return saveCheckpoint(ctx.opts.CheckpointPath, cp)
 }
 
 func validateOptions(options *Options) error {
 	// check convertion options
 	hasUpper, hasLower := false, false
+	seen := make(map[string]bool, len(options.Conv))
 	for _, v := range options.Conv {
 		switch v {
 		case "upper_case":
@@ -74,15 +152,51 @@ func validateOptions(options *Options) error {
 			hasLower = true
 		case "trim_spaces":
 			// OK
+		case "gzip", "gunzip", "deflate", "inflate", "zstd", "zstd_decompress":
+			// OK, handled as a streaming conv
 		default:
 			return fmt.Errorf("unknown conversion type: %s", v)
 		}
+		seen[v] = true
 	}
 
 	if hasLower && hasUpper {
 		return fmt.Errorf("can't use both 'upper_case' and 'lower_case' conversion types")
 	}
 
+	for _, pair := range mutuallyExclusiveConvs {
+		if seen[pair[0]] && seen[pair[1]] {
+			return fmt.Errorf("can't use both %q and %q conversion types", pair[0], pair[1])
+		}
+	}
+
+	if options.Resume && options.CheckpointPath == "" {
+		return fmt.Errorf("--resume requires --checkpoint")
+	}
+
+	if options.CheckpointPath != "" {
+		for _, conv := range options.Conv {
+			if streamingConvs[conv] {
+				return fmt.Errorf("can't use --checkpoint with streaming conv %q: "+
+					"a checkpoint is taken on uncompressed bytes, before the compressor's "+
+					"internal buffers and footer are flushed, so --resume can't continue "+
+					"the compressed output from there", conv)
+			}
+		}
+	}
+
+	if options.Resume && storage.Scheme(options.To) != "file" {
+		return fmt.Errorf("--resume only supports a local --to destination, got %q", options.To)
+	}
+
+	if options.Parallel < 1 {
+		return fmt.Errorf("--parallel must be >= 1, got %d", options.Parallel)
+	}
+
+	if options.Parallel > 1 && (options.Progress || options.CheckpointPath != "") {
+		return fmt.Errorf("--parallel can't be combined with --progress/--checkpoint yet")
+	}
+
 	return nil
 }
 
@@ -99,7 +213,14 @@ func ParseFlags() (*Options, error) {
 	flag.StringVar(&offsetStr, "offset", "0", "byte's offset to read. Default - 0")
 	flag.StringVar(&limitStr, "limit", "0", "byte's limit to read. Default - 0")
 	flag.StringVar(&blockSizeStr, "block-size", "0", "byte's block to work. Default - 0")
-	flag.StringVar(&convStr, "conv", "", "comma-separated list of conversion types. Possible values: upper_case, lower_case, trim_spaces")
+	flag.StringVar(&convStr, "conv", "", "comma-separated list of conversion types. "+
+		"Possible values: upper_case, lower_case, trim_spaces, gzip, gunzip, deflate, inflate, zstd, zstd_decompress")
+	flag.IntVar(&opts.ConvLevel, "conv-level", 0, "compression level forwarded to gzip/deflate/zstd conv types. Default - algorithm default")
+	flag.BoolVar(&opts.Progress, "progress", false, "report progress (bytes/s, ETA) to stderr. Default - false")
+	flag.StringVar(&opts.CheckpointPath, "checkpoint", "", "path to periodically save transfer progress to, for --resume. Default - none")
+	flag.BoolVar(&opts.Resume, "resume", false, "resume a transfer from --checkpoint. Default - false")
+	flag.IntVar(&opts.Parallel, "parallel", 1, "number of workers to run per-block conversions on. "+
+		"Most useful combined with CPU-heavy convs like the compression conv types. Default - 1 (serial)")
 
 	flag.Parse()
 
@@ -130,45 +251,142 @@ func ParseFlags() (*Options, error) {
 }
 
 // Process func for working with main logic for file processing
-func (fp *FileProcessor) Process(src io.Reader, dst io.Writer, opts *Options) error {
-	// 1. Use offset (skip bytes)
-	if err := fp.skipBytes(src, opts.Offset); err != nil {
-		return err
+func (fp *FileProcessor) Process(ctx context.Context, src io.Reader, dst io.Writer, opts *Options) error {
+	// --offset is already applied by getReader (storage.Open takes it and
+	// skips as efficiently as the driver allows); only --resume's extra
+	// progress still needs skipping here, since storage.Open has no way to
+	// know about it.
+	skip := opts.Offset
+
+	var resumeState *Checkpoint
+	if opts.Resume {
+		cp, err := loadCheckpoint(opts.CheckpointPath)
+		if err != nil {
+			return fmt.Errorf("can't resume: %w", err)
+		}
+		resumeState = cp
+		skip += cp.TotalRead
+
+		if err := fp.skipBytes(src, cp.TotalRead); err != nil {
+			return err
+		}
 	}
 
+	sizeHint := sourceSize(src, skip, opts.Limit)
+
 	// 2. Block-size reading with max limit
-	return fp.processData(src, dst, opts)
+	return fp.processData(ctx, src, dst, opts, resumeState, sizeHint)
 }
 
+// skipBytes advances src past offset bytes, e.g. --resume's already-read
+// progress that storage.Open (which only knows about --offset) couldn't
+// have applied.
 func (fp *FileProcessor) skipBytes(src io.Reader, offset uint64) error {
-	if offset > 0 {
-		if _, err := io.CopyN(io.Discard, src, int64(offset)); err != nil {
+	if offset == 0 {
+		return nil
+	}
+
+	// seekable sources (local files, zip members, ...) skip in O(1); this
+	// also avoids pulling the skipped prefix of a remote object over the wire.
+	if seeker, ok := src.(io.Seeker); ok {
+		if _, err := seeker.Seek(int64(offset), io.SeekCurrent); err != nil {
 			return fmt.Errorf("can't skip offset: %w", err)
 		}
+		return nil
+	}
+
+	if _, err := io.CopyN(io.Discard, src, int64(offset)); err != nil {
+		return fmt.Errorf("can't skip offset: %w", err)
 	}
 
 	return nil
 }
 
-func (fp *FileProcessor) processData(src io.Reader, dst io.Writer, opts *Options) error {
-	ctx := newProcessingContext(src, dst, opts, fp)
+func (fp *FileProcessor) processData(sigCtx context.Context, src io.Reader, dst io.Writer, opts *Options, resumeState *Checkpoint, sizeHint uint64) error {
+	var progress *progressReader
+	if opts.Progress {
+		progress = newProgressReader(src, sizeHint)
+		src = progress
+	}
 
-	for {
-		// calc correct bytes for reading
-		toRead := ctx.calculateReadSize()
-		// reach limit
-		if toRead == minSize {
-			break
+	// build the streaming conv chain once: decompressors always wrap src.
+	chainSrc, closeSrcChain, err := buildReaderChain(src, opts.Conv)
+	if err != nil {
+		return fmt.Errorf("can't build reader conv chain: %w", err)
+	}
+	defer closeSrcChain()
+
+	// the trim_spaces + block-size=1 path relies on trimBuffer accumulating
+	// across blocks in order, so parallel workers can't safely split it.
+	hasTrimSpaces := slices.Contains(opts.Conv, "trim_spaces")
+	canParallelize := opts.Parallel > 1 && !(opts.BlockSize == 1 && hasTrimSpaces)
+
+	// when parallelizing, compress-side streaming convs (gzip, deflate,
+	// zstd) run independently per block in the worker pool instead of
+	// compressors wrapping dst here as one shared chain; see processParallel.
+	compressConv, _ := splitCompressConvs(opts.Conv)
+	parallelCompress := canParallelize && len(compressConv) > 0
+
+	var chainDst io.Writer = dst
+	closeDstChain := func() error { return nil }
+	streamConv := compressConv
+	if !parallelCompress {
+		chainDst, closeDstChain, err = buildWriterChain(dst, opts.Conv, opts.ConvLevel)
+		if err != nil {
+			return fmt.Errorf("can't build writer conv chain: %w", err)
 		}
+		streamConv = nil
+	}
+
+	ctx, err := newProcessingContext(chainSrc, chainDst, opts, fp, resumeState, streamConv)
+	if err != nil {
+		return fmt.Errorf("can't set up checkpoint state: %w", err)
+	}
 
-		// invoke reading and processing data
-		err := ctx.readAndProcess(toRead)
-		// check end of file
-		if err == io.EOF {
-			break
+	if canParallelize {
+		if err := fp.processParallel(sigCtx, ctx, opts.Parallel); err != nil {
+			if errors.Is(err, errInterrupted) {
+				return err
+			}
+			return fmt.Errorf("parallel read data error: %w", err)
 		}
-		if err != nil {
-			return fmt.Errorf("read data error: %w", err)
+	} else {
+		for {
+			// SIGINT: checkpoint what's been written so far and stop, at the
+			// cost of at most the block currently in flight.
+			if sigCtx.Err() != nil {
+				if err := ctx.checkpoint(); err != nil {
+					return fmt.Errorf("can't checkpoint on interrupt: %w", err)
+				}
+				return errInterrupted
+			}
+
+			// calc correct bytes for reading
+			toRead := ctx.calculateReadSize()
+			// reach limit
+			if toRead == minSize {
+				// --limit is exhausted without ever issuing the Read call
+				// that would let progress's wrapped reader see io.EOF, so
+				// force a final report here instead.
+				if progress != nil {
+					progress.finish()
+				}
+				break
+			}
+
+			// invoke reading and processing data
+			err := ctx.readAndProcess(toRead)
+			// check end of file
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read data error: %w", err)
+			}
+
+			if err := ctx.maybeCheckpoint(); err != nil {
+				return fmt.Errorf("can't write checkpoint: %w", err)
+			}
 		}
 	}
 
@@ -177,6 +395,15 @@ func (fp *FileProcessor) processData(src io.Reader, dst io.Writer, opts *Options
 		return fmt.Errorf("can't trim spaces: %w", err)
 	}
 
+	// flush/finalize the write-side chain (e.g. gzip footer) before returning
+	if err := closeDstChain(); err != nil {
+		return fmt.Errorf("can't close conv chain: %w", err)
+	}
+
+	if err := ctx.checkpoint(); err != nil {
+		return fmt.Errorf("can't write final checkpoint: %w", err)
+	}
+
 	return nil
 }
 
@@ -204,7 +431,7 @@ func (ctx *ProcessingContext) readAndProcess(toRead uint64) error {
 			ctx.trimBuffer = append(ctx.trimBuffer, ctx.buffer[:n]...)
 		} else {
 			// 3. Apply conversions (Options)
-			processedData := ctx.processor.applyConversions(ctx.buffer[:n], ctx.opts.Conv)
+			processedData := ctx.processor.applyConversions(ctx.buffer[:n], ctx.pureConv)
 
 			// 4. Write result
 			if _, writeErr := ctx.dst.Write(processedData); writeErr != nil {
@@ -249,7 +476,7 @@ func (fp *FileProcessor) Convers(data []byte, conv string) []byte {
 func (ctx *ProcessingContext) finalizeTrimProcessing() error {
 	if ctx.opts.BlockSize == 1 && ctx.hasTrimSpaces && len(ctx.trimBuffer) > 0 {
 		// 3. Apply conversions (Options)
-		processedData := ctx.processor.applyConversions(ctx.trimBuffer, ctx.opts.Conv)
+		processedData := ctx.processor.applyConversions(ctx.trimBuffer, ctx.pureConv)
 
 		// 4. Write result
 		if _, err := ctx.dst.Write(processedData); err != nil {
@@ -290,38 +517,44 @@ func trimSpaces(data []byte) []byte {
 	return []byte(result)
 }
 
-// getReader return Reader (input contents) from options
-func getReader(opts *Options) (io.Reader, func() error, error) {
-	if opts.From == "" {
-		return os.Stdin, func() error { return nil }, nil
-	}
-
-	file, err := os.Open(opts.From)
+// getReader return Reader (input contents) from options. The actual source
+// (local file, s3://, http(s)://, stdin) is resolved by the storage package
+// from opts.From's scheme, which also applies opts.Offset as efficiently
+// as that source allows (e.g. a ranged GET for s3/http instead of
+// downloading and discarding the skipped prefix).
+func getReader(ctx context.Context, opts *Options) (io.Reader, func() error, error) {
+	reader, err := storage.Open(ctx, opts.From, opts.Offset)
 	if err != nil {
-		return nil, func() error { return nil }, fmt.Errorf("can't open input file: %w", err)
+		return nil, func() error { return nil }, err
 	}
 
-	return file, file.Close, nil
+	return reader, reader.Close, nil
 }
 
-// getWriter return Writer (output destination) from options
-func getWriter(opts *Options) (io.Writer, func() error, error) {
-	if opts.To == "" {
-		return os.Stdout, func() error { return nil }, nil
-	}
+// getWriter return Writer (output destination) from options. The actual
+// destination (local file, s3://, stdout) is resolved by the storage package
+// from opts.To's scheme; excl=true preserves the "don't overwrite" behavior.
+//
+// --resume is the one exception: it reopens a local destination in append
+// mode instead, since none of the storage drivers expose one (s3/http have
+// no append semantics, and appending is exactly what a resumed transfer
+// needs from a plain file).
+func getWriter(ctx context.Context, opts *Options) (io.Writer, func() error, error) {
+	if opts.Resume {
+		file, err := os.OpenFile(opts.To, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, func() error { return nil }, fmt.Errorf("can't reopen output file for resume: %w", err)
+		}
 
-	// check existing file
-	if _, err := os.Stat(opts.To); err == nil {
-		return nil, func() error { return nil }, fmt.Errorf("output file already exists: %s", opts.To)
+		return file, file.Close, nil
 	}
 
-	// create new file
-	file, err := os.Create(opts.To)
+	writer, err := storage.Create(ctx, opts.To, true)
 	if err != nil {
-		return nil, func() error { return nil }, fmt.Errorf("can't create output file: %w", err)
+		return nil, func() error { return nil }, err
 	}
 
-	return file, file.Close, nil
+	return writer, writer.Close, nil
 }
 
 func main() {
@@ -332,8 +565,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// SIGINT triggers a checkpoint-and-stop instead of an abrupt kill, so
+	// --resume can pick back up with at most one block lost.
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopSignals()
+
 	// get reader
-	src, srcClose, err := getReader(opts)
+	src, srcClose, err := getReader(sigCtx, opts)
 	if err != nil {
 		// requirement for using Stderr
 		_, _ = fmt.Fprintln(os.Stderr, "can't open input file:", err)
@@ -342,19 +580,41 @@ func main() {
 	defer srcClose()
 
 	// get writer
-	dst, dstClose, err := getWriter(opts)
+	dst, dstClose, err := getWriter(sigCtx, opts)
 	if err != nil {
 		// requirement for using Stderr
 		_, _ = fmt.Fprintln(os.Stderr, "can't create output file:", err)
 		os.Exit(1)
 	}
-	defer dstClose()
 
 	// processing data
+	exitCode := 0
 	processor := &FileProcessor{}
-	if err := processor.Process(src, dst, opts); err != nil {
+	if err := processor.Process(sigCtx, src, dst, opts); err != nil {
+		if errors.Is(err, errInterrupted) {
+			// requirement for using Stderr
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			exitCode = 130 // 128+SIGINT, conventional for interrupted commands
+		} else {
+			// requirement for using Stderr
+			_, _ = fmt.Fprintln(os.Stderr, "can't process file:", err)
+			exitCode = 1
+		}
+	}
+
+	// dstClose is where a buffered destination (tar/zip member rewrite, S3
+	// PutObject, ...) actually does its work, so its error is the only
+	// signal that the write ever really landed; os.Exit skips deferred
+	// calls, so it has to be checked here rather than deferred.
+	if err := dstClose(); err != nil {
 		// requirement for using Stderr
-		_, _ = fmt.Fprintln(os.Stderr, "can't process file:", err)
-		os.Exit(1)
+		_, _ = fmt.Fprintln(os.Stderr, "can't close output:", err)
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// parallelBlock is one unit of work passed between the reader, worker, and
+// writer goroutines in processParallel.
+type parallelBlock struct {
+	seq  uint64
+	orig []byte // pool-owned raw read buffer, returned to the pool once written
+	buf  []byte // data to write; aliases orig when no pureConv was applied
+}
+
+// blockHeap reassembles parallelBlocks in sequence order, since workers can
+// finish out of order.
+type blockHeap []parallelBlock
+
+func (h blockHeap) Len() int            { return len(h) }
+func (h blockHeap) Less(i, j int) bool  { return h[i].seq < h[j].seq }
+func (h blockHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *blockHeap) Push(x interface{}) { *h = append(*h, x.(parallelBlock)) }
+func (h *blockHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// processParallel replaces the serial read->convert->write loop with a
+// worker pool: a reader goroutine fills fixed-size blocks from ctx.src and
+// assigns monotonically increasing sequence numbers, n worker goroutines
+// run applyConversions (and, when ctx.streamConv is set, compressBlock) on
+// their block concurrently, and a single writer goroutine reassembles
+// results in sequence order (a min-heap keyed by seq) before writing to
+// ctx.dst. Block buffers are pooled with sync.Pool to avoid an allocation
+// per block.
+//
+// When ctx.streamConv is non-empty, each worker compresses its own block
+// into a self-contained frame instead of the writer goroutine funneling
+// every block through one shared compressor, so --parallel actually
+// speeds up CPU-heavy compression convs; see compressBlock's doc comment
+// for how the decompress side reassembles the frame sequence. Otherwise
+// ctx.dst is whatever chain processData built up front, same as before.
+//
+// sigCtx is checked between blocks in the reader goroutine, same as the
+// serial loop: on SIGINT it stops pulling new blocks, lets the jobs
+// already in flight drain through the workers and writer, and returns
+// errInterrupted, losing at most the block the reader was about to read.
+func (fp *FileProcessor) processParallel(sigCtx context.Context, ctx *ProcessingContext, workers int) error {
+	blockSize := len(ctx.buffer)
+	pool := sync.Pool{New: func() any { return make([]byte, blockSize) }}
+
+	jobs := make(chan parallelBlock, workers*2)
+	results := make(chan parallelBlock, workers*2)
+
+	var readErr error
+	var interrupted bool
+	go func() {
+		defer close(jobs)
+
+		var seq uint64
+		for {
+			select {
+			case <-sigCtx.Done():
+				interrupted = true
+				return
+			default:
+			}
+
+			toRead := ctx.calculateReadSize()
+			if toRead == minSize {
+				return
+			}
+
+			orig := pool.Get().([]byte)
+			n, err := ctx.src.Read(orig[:toRead])
+			if n > 0 {
+				jobs <- parallelBlock{seq: seq, orig: orig, buf: orig[:n]}
+				ctx.totalRead += uint64(n)
+				seq++
+			} else {
+				pool.Put(orig)
+			}
+
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = fmt.Errorf("read data error: %w", err)
+				return
+			}
+		}
+	}()
+
+	var compressErrOnce sync.Once
+	var compressErr error
+
+	var workersWG sync.WaitGroup
+	workersWG.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer workersWG.Done()
+			for b := range jobs {
+				b.buf = ctx.processor.applyConversions(b.buf, ctx.pureConv)
+
+				if len(ctx.streamConv) > 0 {
+					frame, err := compressBlock(b.buf, ctx.streamConv, ctx.opts.ConvLevel)
+					if err != nil {
+						compressErrOnce.Do(func() {
+							compressErr = fmt.Errorf("compress block error: %w", err)
+						})
+						b.buf = nil
+					} else {
+						b.buf = frame
+					}
+				}
+
+				results <- b
+			}
+		}()
+	}
+
+	go func() {
+		workersWG.Wait()
+		close(results)
+	}()
+
+	var writeErr error
+	next := uint64(0)
+	pending := &blockHeap{}
+	heap.Init(pending)
+
+	for res := range results {
+		heap.Push(pending, res)
+
+		for pending.Len() > 0 && (*pending)[0].seq == next {
+			b := heap.Pop(pending).(parallelBlock)
+
+			if writeErr == nil && compressErr == nil && len(b.buf) > 0 {
+				if _, err := ctx.dst.Write(b.buf); err != nil {
+					writeErr = fmt.Errorf("write processed data error: %w", err)
+				}
+			}
+
+			pool.Put(b.orig[:cap(b.orig)])
+			next++
+		}
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+
+	if interrupted {
+		if err := ctx.checkpoint(); err != nil {
+			return fmt.Errorf("can't checkpoint on interrupt: %w", err)
+		}
+		return errInterrupted
+	}
+
+	if compressErr != nil {
+		return compressErr
+	}
+
+	return writeErr
+}
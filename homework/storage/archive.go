@@ -0,0 +1,510 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ZipDriver implements Storage for "zip:path!member" uris, addressing a
+// single entry inside a zip archive as if it were its own file.
+type ZipDriver struct{}
+
+// TarDriver implements Storage for "tar:path!member" and "tar+gz:path!member"
+// uris, addressing a single entry inside a tar (optionally gzipped) archive.
+type TarDriver struct{ Gzip bool }
+
+func init() {
+	Register("zip", ZipDriver{})
+	Register("tar", TarDriver{Gzip: false})
+	Register("tar+gz", TarDriver{Gzip: true})
+}
+
+// parseArchiveURI splits "scheme:path!member" into the archive path and the
+// member name inside it.
+func parseArchiveURI(uri, scheme string) (path, member string, err error) {
+	rest := strings.TrimPrefix(uri, scheme+":")
+
+	idx := strings.LastIndex(rest, "!")
+	if idx < 0 {
+		return "", "", fmt.Errorf("invalid %s uri %q: missing !member", scheme, uri)
+	}
+
+	return rest[:idx], rest[idx+1:], nil
+}
+
+// zipMethodNames maps the "?method=" suffix on a zip write URI to a
+// zip.FileHeader.Method value, so callers can pick the compression method
+// for the member being written, e.g.
+// "zip:path/to/a.zip!docs/readme.txt?method=store".
+var zipMethodNames = map[string]uint16{
+	"store":   zip.Store,
+	"deflate": zip.Deflate,
+}
+
+// splitZipMethod strips an optional "?method=store|deflate" suffix from
+// member, defaulting to zip.Deflate (today's behavior) when absent.
+func splitZipMethod(member string) (name string, method uint16, err error) {
+	idx := strings.LastIndex(member, "?method=")
+	if idx < 0 {
+		return member, zip.Deflate, nil
+	}
+
+	methodName := member[idx+len("?method="):]
+	method, ok := zipMethodNames[methodName]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown zip compression method %q", methodName)
+	}
+
+	return member[:idx], method, nil
+}
+
+// splitTarSize strips an optional "?size=N" suffix from member, giving the
+// exact size (in bytes) of the member about to be written. tar headers
+// record a member's size up front and have no central directory to patch
+// afterwards, so (unlike zip) a tar member can't be appended without
+// knowing its final length first, e.g.
+// "tar:path/to/a.tar!docs/readme.txt?size=1024".
+func splitTarSize(member string) (name string, size uint64, err error) {
+	idx := strings.LastIndex(member, "?size=")
+	if idx < 0 {
+		return member, 0, fmt.Errorf("writing a tar member requires a ?size= uri suffix " +
+			"(tar has no central directory to rewrite, so a fresh archive is streamed instead)")
+	}
+
+	size, err = strconv.ParseUint(member[idx+len("?size="):], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid tar ?size= suffix in %q: %w", member, err)
+	}
+
+	return member[:idx], size, nil
+}
+
+// Open implements Storage. When the member is stored uncompressed
+// (zip.Store), offset is applied by narrowing the io.SectionReader over
+// the archive, so it skips without downloading the discarded prefix.
+// Compressed members fall back to discarding the prefix from a plain,
+// non-seekable reader.
+func (ZipDriver) Open(_ context.Context, uri string, offset uint64) (io.ReadCloser, error) {
+	path, member, err := parseArchiveURI(uri, "zip")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open zip archive: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't stat zip archive: %w", err)
+	}
+
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't read zip archive: %w", err)
+	}
+
+	entry, err := findZipEntry(zr, member)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if entry.Method == zip.Store {
+		dataOffset, err := entry.DataOffset()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("can't locate zip member data: %w", err)
+		}
+
+		size := int64(entry.UncompressedSize64)
+		if offset > 0 {
+			if offset > uint64(size) {
+				file.Close()
+				return nil, fmt.Errorf("offset %d past end of %d-byte member %q", offset, size, member)
+			}
+			dataOffset += int64(offset)
+			size -= int64(offset)
+		}
+
+		return struct {
+			io.ReadSeeker
+			io.Closer
+		}{
+			ReadSeeker: io.NewSectionReader(file, dataOffset, size),
+			Closer:     file,
+		}, nil
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't open zip member: %w", err)
+	}
+
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, rc, int64(offset)); err != nil {
+			rc.Close()
+			file.Close()
+			return nil, fmt.Errorf("can't skip offset in zip member: %w", err)
+		}
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: rc,
+		Closer: closeBoth(rc, file),
+	}, nil
+}
+
+func findZipEntry(zr *zip.Reader, member string) (*zip.File, error) {
+	for _, f := range zr.File {
+		if f.Name == member {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("member %q not found in zip archive", member)
+}
+
+// closeBoth returns an io.Closer that closes both a and b, in that order,
+// returning the first error.
+func closeBoth(a, b io.Closer) io.Closer {
+	return closerFunc(func() error {
+		errA := a.Close()
+		errB := b.Close()
+		if errA != nil {
+			return errA
+		}
+		return errB
+	})
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// Create implements Storage. Since zip archives carry a trailing central
+// directory, appending a member means rewriting the archive: existing
+// entries are copied verbatim into a new zip alongside the buffered member,
+// then the new file replaces the original.
+func (ZipDriver) Create(_ context.Context, uri string, excl bool) (io.WriteCloser, error) {
+	path, rawMember, err := parseArchiveURI(uri, "zip")
+	if err != nil {
+		return nil, err
+	}
+
+	member, method, err := splitZipMethod(rawMember)
+	if err != nil {
+		return nil, err
+	}
+
+	if excl {
+		if existing, openErr := zip.OpenReader(path); openErr == nil {
+			_, findErr := findZipEntry(&existing.Reader, member)
+			existing.Close()
+			if findErr == nil {
+				return nil, fmt.Errorf("member %q already exists in zip archive", member)
+			}
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "dd-zip-member-*")
+	if err != nil {
+		return nil, fmt.Errorf("can't create staging file: %w", err)
+	}
+
+	return &zipMemberWriter{archivePath: path, member: member, method: method, staging: tmp}, nil
+}
+
+// zipMemberWriter buffers the processed stream to a staging file; Close
+// rewrites the archive with the staged bytes appended under member,
+// compressed with method (zip.Store or zip.Deflate).
+type zipMemberWriter struct {
+	archivePath string
+	member      string
+	method      uint16
+	staging     *os.File
+}
+
+func (w *zipMemberWriter) Write(p []byte) (int, error) {
+	return w.staging.Write(p)
+}
+
+func (w *zipMemberWriter) Close() error {
+	defer os.Remove(w.staging.Name())
+
+	outPath := w.archivePath + ".tmp"
+	out, err := os.Create(outPath)
+	if err != nil {
+		w.staging.Close()
+		return fmt.Errorf("can't create archive: %w", err)
+	}
+
+	zw := zip.NewWriter(out)
+
+	if existing, err := zip.OpenReader(w.archivePath); err == nil {
+		for _, f := range existing.File {
+			if f.Name == w.member {
+				continue // overwritten by the member we're appending
+			}
+			if err := copyZipEntry(zw, f); err != nil {
+				existing.Close()
+				zw.Close()
+				out.Close()
+				w.staging.Close()
+				return err
+			}
+		}
+		existing.Close()
+	}
+
+	if _, err := w.staging.Seek(0, io.SeekStart); err != nil {
+		zw.Close()
+		out.Close()
+		w.staging.Close()
+		return fmt.Errorf("can't rewind staged member: %w", err)
+	}
+
+	entryWriter, err := zw.CreateHeader(&zip.FileHeader{Name: w.member, Method: w.method})
+	if err != nil {
+		zw.Close()
+		out.Close()
+		w.staging.Close()
+		return fmt.Errorf("can't add zip entry: %w", err)
+	}
+
+	if _, err := io.Copy(entryWriter, w.staging); err != nil {
+		zw.Close()
+		out.Close()
+		w.staging.Close()
+		return fmt.Errorf("can't write zip entry: %w", err)
+	}
+
+	w.staging.Close()
+
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("can't finalize zip archive: %w", err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("can't close zip archive: %w", err)
+	}
+
+	return os.Rename(outPath, w.archivePath)
+}
+
+// copyZipEntry copies f's header and raw compressed bytes into zw, without
+// decompressing, so re-archiving unrelated members is O(1) per byte.
+func copyZipEntry(zw *zip.Writer, f *zip.File) error {
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return fmt.Errorf("can't read zip entry %q: %w", f.Name, err)
+	}
+
+	w, err := zw.CreateRaw(&f.FileHeader)
+	if err != nil {
+		return fmt.Errorf("can't copy zip entry %q: %w", f.Name, err)
+	}
+
+	if _, err := io.Copy(w, rc); err != nil {
+		return fmt.Errorf("can't copy zip entry %q: %w", f.Name, err)
+	}
+
+	return nil
+}
+
+// Open implements Storage for TarDriver. tar members have no central
+// index, so the whole archive is scanned for the named header; the
+// returned reader never implements io.Seeker, since tar data (and gzip
+// framing around it) isn't randomly accessible, so offset is applied by
+// discarding the skipped prefix once the member is found.
+func (d TarDriver) Open(_ context.Context, uri string, offset uint64) (io.ReadCloser, error) {
+	scheme := "tar"
+	if d.Gzip {
+		scheme = "tar+gz"
+	}
+
+	path, member, err := parseArchiveURI(uri, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open tar archive: %w", err)
+	}
+
+	var r io.Reader = file
+	var gz *gzip.Reader
+	if d.Gzip {
+		gz, err = gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("can't open gzip-wrapped tar archive: %w", err)
+		}
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("can't read tar archive: %w", err)
+		}
+
+		if hdr.Name == member {
+			if offset > 0 {
+				if _, err := io.CopyN(io.Discard, tr, int64(offset)); err != nil {
+					file.Close()
+					return nil, fmt.Errorf("can't skip offset in tar member: %w", err)
+				}
+			}
+
+			closers := []io.Closer{file}
+			if gz != nil {
+				closers = append(closers, gz)
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{Reader: tr, Closer: closerFunc(func() error { return closeAll(closers) })}, nil
+		}
+	}
+
+	file.Close()
+	return nil, fmt.Errorf("member %q not found in tar archive", member)
+}
+
+func closeAll(closers []io.Closer) error {
+	var firstErr error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Create implements Storage for TarDriver. tar has no central directory to
+// rewrite, so appending to an existing archive isn't supported: this
+// always streams a brand-new archive containing a single member, sized by
+// the "?size=" suffix on the member name (see splitTarSize). Writing fewer
+// or more bytes than that size is an error, since the tar header already
+// committed to it.
+func (d TarDriver) Create(_ context.Context, uri string, excl bool) (io.WriteCloser, error) {
+	scheme := "tar"
+	if d.Gzip {
+		scheme = "tar+gz"
+	}
+
+	path, rawMember, err := parseArchiveURI(uri, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	member, size, err := splitTarSize(rawMember)
+	if err != nil {
+		return nil, err
+	}
+
+	if excl {
+		if _, statErr := os.Stat(path); statErr == nil {
+			return nil, fmt.Errorf("output file already exists: %s", path)
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't create %s archive: %w", scheme, err)
+	}
+
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if d.Gzip {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: member,
+		Mode: 0o644,
+		Size: int64(size),
+	}); err != nil {
+		tw.Close()
+		if gz != nil {
+			gz.Close()
+		}
+		out.Close()
+		return nil, fmt.Errorf("can't write tar header: %w", err)
+	}
+
+	return &tarMemberWriter{tw: tw, gz: gz, out: out, remaining: size}, nil
+}
+
+// tarMemberWriter streams exactly remaining bytes into a single tar member;
+// the tar header already committed to that size, so Close checks the
+// count came out exact.
+type tarMemberWriter struct {
+	tw        *tar.Writer
+	gz        *gzip.Writer // nil for plain tar
+	out       *os.File
+	remaining uint64
+}
+
+func (w *tarMemberWriter) Write(p []byte) (int, error) {
+	if uint64(len(p)) > w.remaining {
+		return 0, fmt.Errorf("storage: wrote past the ?size= uri suffix (%d bytes over)", uint64(len(p))-w.remaining)
+	}
+
+	n, err := w.tw.Write(p)
+	w.remaining -= uint64(n)
+
+	return n, err
+}
+
+func (w *tarMemberWriter) Close() error {
+	if w.remaining > 0 {
+		w.tw.Close()
+		if w.gz != nil {
+			w.gz.Close()
+		}
+		w.out.Close()
+		return fmt.Errorf("storage: short write: %d bytes left to reach the ?size= uri suffix", w.remaining)
+	}
+
+	if err := w.tw.Close(); err != nil {
+		if w.gz != nil {
+			w.gz.Close()
+		}
+		w.out.Close()
+		return fmt.Errorf("can't finalize tar archive: %w", err)
+	}
+
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.out.Close()
+			return fmt.Errorf("can't finalize gzip stream: %w", err)
+		}
+	}
+
+	return w.out.Close()
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestZipRoundTrip writes a multi-member zip, replaces one member through
+// the storage layer, and checks that both the untouched members and the
+// new one survive with a valid local header/central directory.
+func TestZipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "bundle.zip")
+
+	members := map[string]string{
+		"a.txt":        "hello a",
+		"nested/b.txt": "hello b",
+	}
+	writeZip(t, archivePath, members)
+
+	ctx := context.Background()
+
+	w, err := Create(ctx, "zip:"+archivePath+"!nested/b.txt", false)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := w.Write([]byte("updated b")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// untouched member must still be readable as-is
+	assertZipMember(t, ctx, archivePath, "a.txt", "hello a")
+	// updated member must reflect the new contents
+	assertZipMember(t, ctx, archivePath, "nested/b.txt", "updated b")
+
+	// the archive itself must remain a structurally valid zip
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatalf("re-opening archive: %v", err)
+	}
+	defer zr.Close()
+
+	if len(zr.File) != 2 {
+		t.Fatalf("expected 2 entries in archive, got %d", len(zr.File))
+	}
+}
+
+func writeZip(t *testing.T, path string, members map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating zip: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range members {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("adding zip entry %q: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("writing zip entry %q: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip writer: %v", err)
+	}
+}
+
+func assertZipMember(t *testing.T, ctx context.Context, archivePath, member, want string) {
+	t.Helper()
+
+	r, err := Open(ctx, "zip:"+archivePath+"!"+member, 0)
+	if err != nil {
+		t.Fatalf("Open %q: %v", member, err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %q: %v", member, err)
+	}
+
+	if !bytes.Equal(got, []byte(want)) {
+		t.Fatalf("member %q = %q, want %q", member, got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FileDriver implements Storage for the local filesystem, plus "-" for
+// stdin/stdout. It's the default driver and holds the behavior that used
+// to live directly in cmd's getReader/getWriter.
+type FileDriver struct{}
+
+func init() {
+	Register("file", FileDriver{})
+}
+
+// Open implements Storage. offset is applied with a single Seek, since
+// local files are always seekable.
+func (FileDriver) Open(_ context.Context, uri string, offset uint64) (io.ReadCloser, error) {
+	path := trimScheme(uri, "file")
+	if path == "" || path == "-" {
+		// stdin isn't seekable, so offset is applied by discarding the
+		// skipped prefix instead.
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, os.Stdin, int64(offset)); err != nil {
+				return nil, fmt.Errorf("can't skip offset on stdin: %w", err)
+			}
+		}
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open input file: %w", err)
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(int64(offset), io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("can't seek to offset %d: %w", offset, err)
+		}
+	}
+
+	return file, nil
+}
+
+// Create implements Storage.
+func (FileDriver) Create(_ context.Context, uri string, excl bool) (io.WriteCloser, error) {
+	path := trimScheme(uri, "file")
+	if path == "" || path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+
+	if excl {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("output file already exists: %s", path)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't create output file: %w", err)
+	}
+
+	return file, nil
+}
+
+// trimScheme strips an optional "file://" prefix, leaving bare paths (and
+// "-") untouched.
+func trimScheme(uri, scheme string) string {
+	return strings.TrimPrefix(uri, scheme+"://")
+}
+
+// nopWriteCloser adapts os.Stdout (which we must not Close) to io.WriteCloser.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
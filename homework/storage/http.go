@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// HTTPDriver implements Storage for http(s):// sources. It's read-only:
+// Create always fails, since there's no generic way to upload to an
+// arbitrary URL.
+type HTTPDriver struct {
+	Client *http.Client
+}
+
+func init() {
+	Register("http", HTTPDriver{Client: http.DefaultClient})
+	Register("https", HTTPDriver{Client: http.DefaultClient})
+}
+
+// Open implements Storage. offset is requested as a Range header, so a
+// server that honors it (206 Partial Content) never sends the skipped
+// prefix; a server that doesn't (200 OK regardless) falls back to
+// discarding it locally, so either way the caller gets the right bytes.
+func (d HTTPDriver) Open(ctx context.Context, uri string, offset uint64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't build request: %w", err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatUint(offset, 10)+"-")
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch %s: %w", uri, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			// server ignored the Range request and sent the whole body
+			// from the start; skip the prefix ourselves.
+			if _, err := io.CopyN(io.Discard, resp.Body, int64(offset)); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("can't skip offset fetching %s: %w", uri, err)
+			}
+		}
+	case http.StatusPartialContent:
+		// server applied the Range request; resp.Body already starts at offset.
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", uri, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// Create implements Storage. http(s) is a read-only driver.
+func (HTTPDriver) Create(_ context.Context, uri string, _ bool) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("storage: %s is read-only, can't write to it", uri)
+}
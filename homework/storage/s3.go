@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3Driver implements Storage for s3://bucket/key sources and destinations.
+// It creates an *s3.Client from the default AWS config only when Open or
+// Create is called (a fresh client on every call), so importing this driver
+// has no cost when --from/--to never use the s3 scheme.
+type S3Driver struct{}
+
+func init() {
+	Register("s3", S3Driver{})
+}
+
+func (S3Driver) client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't load AWS config: %w", err)
+	}
+
+	return s3.NewFromConfig(cfg), nil
+}
+
+// splitBucketKey parses "s3://bucket/key" into its bucket and key parts.
+func splitBucketKey(uri string) (bucket, key string, err error) {
+	rest := strings.TrimPrefix(uri, "s3://")
+	idx := strings.Index(rest, "/")
+	if idx < 0 {
+		return "", "", fmt.Errorf("invalid s3 uri %q: missing key", uri)
+	}
+
+	return rest[:idx], rest[idx+1:], nil
+}
+
+// Open implements Storage. The returned reader wraps the GetObject body,
+// which doesn't implement io.Seeker; offset is instead applied as a ranged
+// GET, so the skipped prefix is never downloaded.
+func (d S3Driver) Open(ctx context.Context, uri string, offset uint64) (io.ReadCloser, error) {
+	bucket, key, err := splitBucketKey(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	out, err := client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("can't get s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return out.Body, nil
+}
+
+// isNotFound reports whether err is S3's "object doesn't exist" response to
+// HeadObject, so Create's excl check can tell that apart from other
+// failures (permissions, network, ...) that should be surfaced instead of
+// silently treated as "safe to overwrite". HeadObject's response has no
+// body to decode, so a missing object doesn't always come back as the
+// modeled *s3types.NotFound; the SDK commonly synthesizes a generic
+// smithy.APIError with ErrorCode "NotFound" instead, so both are checked.
+func isNotFound(err error) bool {
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound"
+}
+
+// Create implements Storage. S3 has no append/streaming PutObject, so the
+// returned writer buffers to memory and uploads the whole object on Close.
+func (d S3Driver) Create(ctx context.Context, uri string, excl bool) (io.WriteCloser, error) {
+	bucket, key, err := splitBucketKey(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if excl {
+		_, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		switch {
+		case err == nil:
+			return nil, fmt.Errorf("output object already exists: s3://%s/%s", bucket, key)
+		case isNotFound(err):
+			// OK, nothing to overwrite
+		default:
+			return nil, fmt.Errorf("can't check s3://%s/%s: %w", bucket, key, err)
+		}
+	}
+
+	return &s3Writer{ctx: ctx, client: client, bucket: bucket, key: key}, nil
+}
+
+// s3Writer buffers written bytes and uploads them as a single PutObject on
+// Close, since S3 doesn't support incremental writes to an object. Until
+// Close runs, nothing has actually reached S3, so a caller that ignores
+// Close's returned error (as a bare `defer writer.Close()` would) reports a
+// transfer as successful even when the upload itself failed; callers must
+// check it explicitly, same as main does.
+type s3Writer struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	buf    []byte
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *s3Writer) Close() error {
+	_, err := w.client.PutObject(w.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.key),
+		Body:   bytes.NewReader(w.buf),
+	})
+	if err != nil {
+		return fmt.Errorf("can't put s3://%s/%s: %w", w.bucket, w.key, err)
+	}
+
+	return nil
+}